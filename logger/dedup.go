@@ -0,0 +1,100 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// deduper wraps a slog.Handler and suppresses records that are identical
+// (same level, message and attributes) to one already emitted within the
+// configurable window, forward-ported from Prometheus's go-kit Deduper.
+type deduper struct {
+	next   slog.Handler
+	window time.Duration
+
+	// mu guards seen. Every clone produced by WithAttrs/WithGroup (e.g.
+	// one per probe, via Logger.With) shares both mu and seen with the
+	// deduper it was cloned from, since they all dedup against the same
+	// record history; giving each clone its own mutex over a shared map
+	// would let concurrent probes race on it.
+	mu   *sync.Mutex
+	seen map[string]time.Time
+
+	// attrKey holds the attributes and groups added through WithAttrs/
+	// WithGroup, so records from clones with different attributes (e.g.
+	// two probes' loggers) get distinct keys.
+	attrKey string
+}
+
+func newDeduper(next slog.Handler, windowSeconds int) *deduper {
+	return &deduper{
+		next:   next,
+		window: time.Duration(windowSeconds) * time.Second,
+		mu:     &sync.Mutex{},
+		seen:   make(map[string]time.Time),
+	}
+}
+
+func (d *deduper) Enabled(ctx context.Context, level slog.Level) bool {
+	return d.next.Enabled(ctx, level)
+}
+
+func (d *deduper) Handle(ctx context.Context, r slog.Record) error {
+	key := d.attrKey + dedupKey(r)
+
+	d.mu.Lock()
+	last, ok := d.seen[key]
+	now := time.Now()
+	if ok && now.Sub(last) < d.window {
+		d.mu.Unlock()
+		return nil
+	}
+	d.seen[key] = now
+	// Opportunistically forget old keys so the map doesn't grow
+	// unbounded across a long-running process.
+	for k, t := range d.seen {
+		if now.Sub(t) >= d.window {
+			delete(d.seen, k)
+		}
+	}
+	d.mu.Unlock()
+
+	return d.next.Handle(ctx, r)
+}
+
+func (d *deduper) WithAttrs(attrs []slog.Attr) slog.Handler {
+	key := d.attrKey
+	for _, a := range attrs {
+		key += "|" + a.String()
+	}
+	return &deduper{next: d.next.WithAttrs(attrs), window: d.window, mu: d.mu, seen: d.seen, attrKey: key}
+}
+
+func (d *deduper) WithGroup(name string) slog.Handler {
+	return &deduper{next: d.next.WithGroup(name), window: d.window, mu: d.mu, seen: d.seen, attrKey: d.attrKey + "|" + name + "."}
+}
+
+func dedupKey(r slog.Record) string {
+	key := r.Level.String() + "|" + r.Message
+	r.Attrs(func(a slog.Attr) bool {
+		key += "|" + a.String()
+		return true
+	})
+	return key
+}
@@ -0,0 +1,452 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package cluster implements gossip-based membership and probe-ownership
+for cloudprober's HA mode.
+
+Members advertise their hostname, join time and zone over a memberlist
+gossip ring; the advertised state also has a capability set, which nothing
+populates and which ownership does not consult. Every member independently runs the same consistent
+hash function over the current (converged) member list to decide, for each
+probe name, which member(s) own it -- there is no leader and no consensus
+round-trip involved. Ownership changes (a peer joining, leaving or being
+marked dead) are debounced behind a short stabilization delay so that a
+rolling restart doesn't cause every probe to bounce between nodes.
+*/
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudprober/cloudprober/logger"
+	"github.com/hashicorp/memberlist"
+)
+
+// VirtualNodes is the number of points each member gets on the hash ring.
+// A higher count gives a more even probe distribution at the cost of a
+// larger ring to scan on every ownership computation.
+const VirtualNodes = 128
+
+// Config configures the cluster subsystem. It's derived from the
+// ProberConfig's cluster field.
+type Config struct {
+	// Name this member advertises to the rest of the cluster. Defaults to
+	// the host's hostname if empty.
+	Name string
+
+	// Zone this member belongs to. When ZoneAware is set, replicas for a
+	// probe are spread across distinct zones where possible.
+	Zone      string
+	ZoneAware bool
+
+	// ReplicationFactor is the number of members that should run each
+	// probe concurrently. Defaults to 1 (exactly one owner per probe).
+	ReplicationFactor int
+
+	// BindAddr/BindPort is where this member listens for gossip traffic.
+	BindAddr string
+	BindPort int
+
+	// Peers is the initial set of "host:port" addresses to join through.
+	Peers []string
+
+	// StabilizationDelay is how long ownership must remain unchanged
+	// before OnChange is fired, to avoid flapping while a ring of
+	// instances restarts one at a time.
+	StabilizationDelay time.Duration
+}
+
+func (c *Config) replicationFactor() int {
+	if c.ReplicationFactor <= 0 {
+		return 1
+	}
+	return c.ReplicationFactor
+}
+
+// member is the gossip-broadcast state for a single cluster member.
+type member struct {
+	Name         string
+	JoinedAt     time.Time
+	Zone         string
+	Capabilities []string
+}
+
+// Cluster maintains a memberlist-backed gossip ring and the consistent-hash
+// ownership table derived from it.
+type Cluster struct {
+	cfg *Config
+	l   *logger.Logger
+
+	// name is this member's memberlist node name, fixed before the
+	// memberlist is created.
+	name string
+
+	ml *memberlist.Memberlist
+
+	mu        sync.RWMutex
+	members   map[string]*member
+	ring      []ringPoint
+	unhealthy map[string]bool
+
+	changeMu  sync.Mutex
+	onChange  []func(owned, released []string)
+	stableAt  time.Time
+	stableGen uint64
+	// pendingPrev is the ownership snapshot from the first event of the
+	// burst currently being debounced by scheduleReconcile.
+	pendingPrev map[string]bool
+
+	// probeListerMu guards probeLister, which is written once by
+	// SetProbeLister but read from whatever goroutine memberlist is
+	// delivering join/leave/update events on.
+	probeListerMu sync.Mutex
+	// probeLister enumerates the probe names configured on this instance;
+	// set via SetProbeLister before Join is called.
+	probeLister func() []string
+}
+
+type ringPoint struct {
+	hash   uint32
+	member string
+}
+
+// New creates a Cluster and starts it listening for gossip traffic, but
+// does not yet join the ring described by cfg.Peers. Callers must call
+// SetProbeLister and register every OnChange callback, then call Join --
+// in that order -- since memberlist can start delivering join/leave/update
+// events for other members as soon as Join returns (or, for peers already
+// up, even before it returns), and those events read probeLister and fire
+// onChange.
+func New(cfg *Config, l *logger.Logger) (*Cluster, error) {
+	c := &Cluster{
+		cfg:     cfg,
+		l:       l,
+		members: make(map[string]*member),
+	}
+
+	mlConf := memberlist.DefaultLANConfig()
+	if cfg.Name != "" {
+		mlConf.Name = cfg.Name
+	}
+	if cfg.BindAddr != "" {
+		mlConf.BindAddr = cfg.BindAddr
+	}
+	if cfg.BindPort != 0 {
+		mlConf.BindPort = cfg.BindPort
+		mlConf.AdvertisePort = cfg.BindPort
+	}
+	mlConf.Delegate = &delegate{c: c}
+	mlConf.Events = &eventDelegate{c: c}
+
+	// memberlist asks the delegate for this node's metadata from inside
+	// Create, so the local member must be in place before Create runs.
+	c.name = mlConf.Name
+	c.addOrUpdateMember(&member{Name: c.name, JoinedAt: time.Now(), Zone: cfg.Zone})
+
+	ml, err := memberlist.Create(mlConf)
+	if err != nil {
+		return nil, fmt.Errorf("cluster: error creating memberlist: %v", err)
+	}
+	c.ml = ml
+
+	return c, nil
+}
+
+// Join connects to the gossip ring via cfg.Peers, if any were configured.
+// Call it only after SetProbeLister and every OnChange callback have been
+// registered -- see New's doc comment for why ordering matters here.
+func (c *Cluster) Join() error {
+	if len(c.cfg.Peers) == 0 {
+		return nil
+	}
+	if _, err := c.ml.Join(c.cfg.Peers); err != nil {
+		return fmt.Errorf("cluster: error joining peers %v: %v", c.cfg.Peers, err)
+	}
+	return nil
+}
+
+// OnChange registers a callback invoked, after the stabilization delay has
+// elapsed without further membership churn, with the set of probe names
+// this node newly owns and the set it has just released.
+func (c *Cluster) OnChange(f func(owned, released []string)) {
+	c.changeMu.Lock()
+	defer c.changeMu.Unlock()
+	c.onChange = append(c.onChange, f)
+}
+
+// LocalName returns the name this member advertises on the ring.
+func (c *Cluster) LocalName() string {
+	return c.name
+}
+
+func (c *Cluster) addOrUpdateMember(m *member) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.members[m.Name] = m
+	c.rebuildRingLocked()
+}
+
+func (c *Cluster) removeMember(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.members, name)
+	c.rebuildRingLocked()
+}
+
+func (c *Cluster) rebuildRingLocked() {
+	ring := make([]ringPoint, 0, len(c.members)*VirtualNodes)
+	for name := range c.members {
+		for i := 0; i < VirtualNodes; i++ {
+			ring = append(ring, ringPoint{hash: hashKey(fmt.Sprintf("%s-%d", name, i)), member: name})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+	c.ring = ring
+}
+
+// Owners returns, in preference order, the members that should run probe
+// name under the configured replication factor. Callers typically care
+// only about Owners(name)[0] unless zone-awareness or RF > 1 is in use.
+//
+// Members marked unhealthy by SetPeerHealthy are skipped, so a peer
+// failing its liveness probes is ejected faster than gossip's own failure
+// detector would mark it dead. If every candidate owner for name happens
+// to be unhealthy, Owners falls back to including them rather than
+// returning no owner at all and dropping the probe entirely.
+func (c *Cluster) Owners(name string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	owners := c.ownersLocked(name, true)
+	if len(owners) == 0 {
+		owners = c.ownersLocked(name, false)
+	}
+	return owners
+}
+
+// ownersLocked implements Owners; must be called with c.mu held for
+// reading. When skipUnhealthy is set, members in c.unhealthy are excluded
+// from consideration.
+func (c *Cluster) ownersLocked(name string, skipUnhealthy bool) []string {
+	if len(c.ring) == 0 {
+		return nil
+	}
+
+	rf := c.cfg.replicationFactor()
+	h := hashKey(name)
+	idx := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= h })
+
+	seen := make(map[string]bool)
+	zonesUsed := make(map[string]bool)
+	var owners []string
+	for i := 0; i < len(c.ring) && len(owners) < rf; i++ {
+		p := c.ring[(idx+i)%len(c.ring)]
+		if seen[p.member] {
+			continue
+		}
+		if skipUnhealthy && c.unhealthy[p.member] {
+			continue
+		}
+		if c.cfg.ZoneAware && len(owners) > 0 {
+			if z := c.members[p.member].Zone; z != "" && zonesUsed[z] {
+				continue
+			}
+		}
+		seen[p.member] = true
+		if m := c.members[p.member]; m != nil {
+			zonesUsed[m.Zone] = true
+		}
+		owners = append(owners, p.member)
+	}
+
+	// Fewer distinct zones than rf: fill the remaining replicas from the
+	// ring regardless of zone.
+	if c.cfg.ZoneAware {
+		for i := 0; i < len(c.ring) && len(owners) < rf; i++ {
+			p := c.ring[(idx+i)%len(c.ring)]
+			if seen[p.member] || (skipUnhealthy && c.unhealthy[p.member]) {
+				continue
+			}
+			seen[p.member] = true
+			owners = append(owners, p.member)
+		}
+	}
+	return owners
+}
+
+// SetPeerHealthy records a peer-liveness verdict for member name, fed back
+// from the probing package's RTT/loss measurements. Owns() and Owners()
+// reflect the new verdict on their next call. When the verdict changes, it
+// also schedules the same debounced OnChange reconciliation as a
+// membership change, so probes are started or stopped accordingly.
+func (c *Cluster) SetPeerHealthy(name string, healthy bool) {
+	c.mu.RLock()
+	changed := c.unhealthy[name] == healthy
+	c.mu.RUnlock()
+	if !changed {
+		return
+	}
+
+	prev := c.snapshotOwned()
+	c.mu.Lock()
+	if c.unhealthy == nil {
+		c.unhealthy = make(map[string]bool)
+	}
+	if healthy {
+		delete(c.unhealthy, name)
+	} else {
+		c.unhealthy[name] = true
+	}
+	c.mu.Unlock()
+	c.scheduleReconcile(prev)
+}
+
+// Owns reports whether this member is among the current owners of probe
+// name.
+func (c *Cluster) Owns(name string) bool {
+	local := c.LocalName()
+	for _, o := range c.Owners(name) {
+		if o == local {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerView is the debug snapshot returned by the /cluster gRPC method.
+type PeerView struct {
+	Members []string
+	Owners  map[string][]string
+}
+
+// View returns a point-in-time snapshot of cluster membership, used by
+// the debug /cluster gRPC method. probeNames should be the set of probes
+// configured on this instance.
+func (c *Cluster) View(probeNames []string) *PeerView {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.members))
+	for n := range c.members {
+		names = append(names, n)
+	}
+	c.mu.RUnlock()
+	sort.Strings(names)
+
+	owners := make(map[string][]string, len(probeNames))
+	for _, p := range probeNames {
+		owners[p] = c.Owners(p)
+	}
+	return &PeerView{Members: names, Owners: owners}
+}
+
+// snapshotOwned returns the set of probes this node currently owns,
+// computed against the ring as it stands right now. Callers must take
+// this snapshot *before* applying the membership mutation that triggered
+// it, so that scheduleReconcile has a true before/after pair to diff
+// rather than comparing the post-mutation ring against itself.
+func (c *Cluster) snapshotOwned() map[string]bool {
+	owned := make(map[string]bool)
+	lister := c.getProbeLister()
+	if lister == nil {
+		return owned
+	}
+	for _, p := range lister() {
+		if c.Owns(p) {
+			owned[p] = true
+		}
+	}
+	return owned
+}
+
+// getProbeLister returns the function set by SetProbeLister, or nil if
+// none has been set yet.
+func (c *Cluster) getProbeLister() func() []string {
+	c.probeListerMu.Lock()
+	defer c.probeListerMu.Unlock()
+	return c.probeLister
+}
+
+// scheduleReconcile is called by the event delegate on every join/leave/
+// update, with the ownership snapshot taken immediately before that
+// event's membership mutation was applied. It debounces the resulting
+// reconciliation behind StabilizationDelay so a rolling restart doesn't
+// thrash probe ownership, then diffs the snapshot taken before the first
+// event of the burst against ownership computed on the now-stable ring.
+func (c *Cluster) scheduleReconcile(prevOwned map[string]bool) {
+	c.changeMu.Lock()
+	c.stableGen++
+	gen := c.stableGen
+	if c.pendingPrev == nil {
+		c.pendingPrev = prevOwned
+	}
+	c.changeMu.Unlock()
+
+	delay := c.cfg.StabilizationDelay
+	if delay <= 0 {
+		delay = 5 * time.Second
+	}
+
+	time.AfterFunc(delay, func() {
+		c.changeMu.Lock()
+		stale := gen != c.stableGen
+		prev := c.pendingPrev
+		if !stale {
+			c.pendingPrev = nil
+		}
+		c.changeMu.Unlock()
+		if stale {
+			return
+		}
+
+		lister := c.getProbeLister()
+		if lister == nil {
+			return
+		}
+
+		var owned, released []string
+		for _, p := range lister() {
+			now := c.Owns(p)
+			switch {
+			case now && !prev[p]:
+				owned = append(owned, p)
+			case !now && prev[p]:
+				released = append(released, p)
+			}
+		}
+		if len(owned) == 0 && len(released) == 0 {
+			return
+		}
+
+		c.changeMu.Lock()
+		callbacks := append([]func(owned, released []string){}, c.onChange...)
+		c.changeMu.Unlock()
+		for _, f := range callbacks {
+			f(owned, released)
+		}
+	})
+}
+
+func hashKey(s string) uint32 {
+	// FNV-1a; good enough distribution for ring placement and avoids
+	// pulling in a hashing dependency beyond the standard library.
+	var h uint32 = 2166136261
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestHashKeyDeterministic(t *testing.T) {
+	a := hashKey("probe-a")
+	b := hashKey("probe-a")
+	if a != b {
+		t.Fatalf("hashKey not deterministic: %d != %d", a, b)
+	}
+	if hashKey("probe-a") == hashKey("probe-b") {
+		t.Fatalf("hashKey collided for distinct inputs (unlucky, but check the implementation)")
+	}
+}
+
+func newTestCluster(memberNames ...string) *Cluster {
+	c := &Cluster{
+		cfg:     &Config{ReplicationFactor: 1},
+		members: make(map[string]*member),
+	}
+	if len(memberNames) > 0 {
+		c.name = memberNames[0]
+	}
+	for _, n := range memberNames {
+		c.members[n] = &member{Name: n}
+	}
+	c.rebuildRingLocked()
+	return c
+}
+
+func TestOwnersStableForSameRing(t *testing.T) {
+	c := newTestCluster("a", "b", "c")
+
+	first := c.Owners("some-probe")
+	if len(first) != 1 {
+		t.Fatalf("expected exactly one owner, got %v", first)
+	}
+
+	for i := 0; i < 10; i++ {
+		got := c.Owners("some-probe")
+		if len(got) != 1 || got[0] != first[0] {
+			t.Fatalf("Owners() not stable across calls: %v vs %v", first, got)
+		}
+	}
+}
+
+func TestOwnersChangesOnMembershipChange(t *testing.T) {
+	c := newTestCluster("a", "b", "c")
+
+	before := c.Owners("some-probe")[0]
+
+	// Removing the current owner must hand the probe to someone else,
+	// not silently keep returning the no-longer-present member.
+	delete(c.members, before)
+	c.rebuildRingLocked()
+
+	after := c.Owners("some-probe")
+	if len(after) != 1 {
+		t.Fatalf("expected exactly one owner after removal, got %v", after)
+	}
+	if after[0] == before {
+		t.Fatalf("Owners() still returned removed member %q", before)
+	}
+}
+
+func TestOwnersSkipsUnhealthyMember(t *testing.T) {
+	c := newTestCluster("a", "b", "c")
+
+	owner := c.Owners("some-probe")[0]
+	c.SetPeerHealthy(owner, false)
+
+	after := c.Owners("some-probe")
+	if len(after) != 1 {
+		t.Fatalf("expected exactly one owner, got %v", after)
+	}
+	if after[0] == owner {
+		t.Fatalf("Owners() still returned %q after it was marked unhealthy", owner)
+	}
+
+	c.SetPeerHealthy(owner, true)
+	if got := c.Owners("some-probe"); len(got) != 1 || got[0] != owner {
+		t.Fatalf("Owners() = %v after re-marking %q healthy, want [%q]", got, owner, owner)
+	}
+}
+
+func TestOwnersFallsBackWhenAllUnhealthy(t *testing.T) {
+	c := newTestCluster("a", "b", "c")
+
+	for _, name := range []string{"a", "b", "c"} {
+		c.SetPeerHealthy(name, false)
+	}
+
+	// Every candidate is unhealthy; Owners must still return someone
+	// rather than silently dropping the probe.
+	got := c.Owners("some-probe")
+	if len(got) != 1 {
+		t.Fatalf("expected a fallback owner when all members are unhealthy, got %v", got)
+	}
+}
+
+func TestSnapshotOwnedReflectsPreMutationRing(t *testing.T) {
+	c := newTestCluster("a", "b")
+	c.probeLister = func() []string { return []string{"p1", "p2", "p3"} }
+
+	owner := map[string]bool{}
+	for _, p := range c.probeLister() {
+		owner[p] = c.Owns(p)
+	}
+
+	prev := c.snapshotOwned()
+	for p, want := range owner {
+		if prev[p] != want {
+			t.Fatalf("snapshotOwned()[%q] = %v, want %v", p, prev[p], want)
+		}
+	}
+
+	// Mutating the ring after the snapshot was taken must not retroactively
+	// change it -- this is the invariant the join/leave ordering bug broke.
+	delete(c.members, "a")
+	c.rebuildRingLocked()
+
+	for p, want := range owner {
+		if prev[p] != want {
+			t.Fatalf("snapshotOwned() mutated after ring rebuild: [%q] = %v, want %v", p, prev[p], want)
+		}
+	}
+}
+
+// TestSetProbeListerConcurrentWithReads exercises SetProbeLister and
+// snapshotOwned/scheduleReconcile's read path concurrently, the way a
+// SetProbeLister call racing with memberlist's own event-callback
+// goroutine would -- this must not trip the race detector.
+func TestSetProbeListerConcurrentWithReads(t *testing.T) {
+	c := newTestCluster("a", "b")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.SetProbeLister(func() []string { return []string{"p1"} })
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			c.snapshotOwned()
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,88 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"encoding/json"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// delegate implements memberlist.Delegate, broadcasting this member's
+// state (hostname, join time, zone) to the rest of the ring. The state's
+// capability set is always empty.
+type delegate struct {
+	c *Cluster
+}
+
+func (d *delegate) NodeMeta(limit int) []byte {
+	d.c.mu.RLock()
+	m := d.c.members[d.c.LocalName()]
+	d.c.mu.RUnlock()
+	if m == nil {
+		return nil
+	}
+	b, _ := json.Marshal(m)
+	if len(b) > limit {
+		return nil
+	}
+	return b
+}
+
+func (d *delegate) NotifyMsg([]byte)                           {}
+func (d *delegate) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+func (d *delegate) LocalState(join bool) []byte                { return nil }
+func (d *delegate) MergeRemoteState(buf []byte, join bool)     {}
+
+// eventDelegate reacts to memberlist join/leave/update notifications by
+// updating the local ring and kicking off the debounced reconciliation.
+type eventDelegate struct {
+	c *Cluster
+}
+
+func (e *eventDelegate) NotifyJoin(n *memberlist.Node) {
+	prev := e.c.snapshotOwned()
+	e.c.addOrUpdateMember(decodeMember(n))
+	e.c.scheduleReconcile(prev)
+}
+
+func (e *eventDelegate) NotifyLeave(n *memberlist.Node) {
+	prev := e.c.snapshotOwned()
+	e.c.removeMember(n.Name)
+	e.c.scheduleReconcile(prev)
+}
+
+func (e *eventDelegate) NotifyUpdate(n *memberlist.Node) {
+	prev := e.c.snapshotOwned()
+	e.c.addOrUpdateMember(decodeMember(n))
+	e.c.scheduleReconcile(prev)
+}
+
+func decodeMember(n *memberlist.Node) *member {
+	m := &member{Name: n.Name}
+	json.Unmarshal(n.Meta, m)
+	m.Name = n.Name
+	return m
+}
+
+// SetProbeLister wires in the function the cluster uses to enumerate the
+// probe names configured on this instance. Call it before Join, since
+// Join can start delivering memberlist events -- which read probeLister --
+// immediately.
+func (c *Cluster) SetProbeLister(f func() []string) {
+	c.probeListerMu.Lock()
+	defer c.probeListerMu.Unlock()
+	c.probeLister = f
+}
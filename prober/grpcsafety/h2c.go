@@ -0,0 +1,46 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcsafety
+
+import (
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// SharedHandler multiplexes gRPC and plain HTTP traffic onto a single h2c
+// (HTTP/2 cleartext) handler, so a single listener can serve the gRPC
+// CloudproberServer/RDS services alongside the /status and /config HTTP
+// endpoints -- the single-exposed-port deployment shape most k8s sidecars
+// need. It dispatches on Content-Type the way grpc-go's own examples do:
+// gRPC requests are always POSTs with a "application/grpc" content type.
+func SharedHandler(grpcHandler, httpHandler http.Handler, cfg *Config) http.Handler {
+	mux := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+
+	h2s := &http2.Server{}
+	if cfg != nil {
+		h2s.MaxConcurrentStreams = cfg.MaxConcurrentStreams
+		h2s.MaxHeaderListSize = cfg.MaxHeaderListSize
+	}
+	return h2c.NewHandler(mux, h2s)
+}
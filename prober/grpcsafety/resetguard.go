@@ -0,0 +1,230 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package grpcsafety hardens the embedded gRPC/HTTP2 listener against
+HTTP/2 abuse, in particular the "rapid reset" pattern behind CVE-2023-44487:
+a client that opens a stream and immediately RST_STREAMs it, over and over,
+to force the server to do request-processing work without ever completing
+a response. grpc-go and golang.org/x/net/http2 both apply their own
+mitigations, but this package adds a belt-and-suspenders per-connection
+rate limiter that the operator can tune, and tears down a connection as
+soon as it crosses the configured threshold rather than waiting on a
+stream-count ceiling.
+
+The extra rate limiter only works by reading cleartext HTTP/2 frame
+headers off the wire, so it only ever scans connections that start with
+the literal HTTP/2 client preface -- i.e. plain h2c traffic, such as the
+shared listener SharedHandler sets up. A connection that's actually a TLS
+handshake (the common shape for the main gRPC listener, via
+credentials.NewTLS) never matches that preface, since grpc-go performs
+the TLS handshake itself after Accept and this package has no hook into
+the decrypted stream; resetGuardConn detects the mismatch on the first
+read and stops inspecting that connection for the rest of its life
+rather than misreading ciphertext as frame headers. Those connections
+fall back to relying on grpc-go's and x/net/http2's own built-in
+mitigations.
+*/
+package grpcsafety
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// http2FrameTypeRSTStream is the HTTP/2 frame type byte for RST_STREAM, as
+// defined in RFC 7540 section 6.4.
+const http2FrameTypeRSTStream = 0x3
+
+// http2FrameHeaderLen is the length, in bytes, of an HTTP/2 frame header:
+// a 24-bit length, an 8-bit type, an 8-bit flags field and a 32-bit stream
+// ID.
+const http2FrameHeaderLen = 9
+
+// http2ClientPreface is the mandatory connection preface (RFC 7540
+// section 3.5) every HTTP/2 client -- including every gRPC and h2c client
+// -- sends before its first frame. The scanner must skip over it, or it
+// spends the rest of the connection's lifetime misreading preface/frame
+// bytes as frame headers.
+const http2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// Config tunes the abuse mitigations applied to the shared gRPC/HTTP2
+// listener.
+type Config struct {
+	// MaxConcurrentStreams caps concurrent HTTP/2 streams per connection,
+	// passed through to the http2.Server. 0 leaves the library default.
+	MaxConcurrentStreams uint32
+
+	// MaxHeaderListSize caps the cumulative size of request headers a
+	// single connection may send, passed through to the http2.Server.
+	MaxHeaderListSize uint32
+
+	// MaxResetsPerSecond is the sustained rate of RST_STREAM frames a
+	// single connection may send before it's torn down. 0 disables the
+	// reset-rate limiter entirely.
+	MaxResetsPerSecond float64
+}
+
+// WrapListener wraps ln so that every accepted connection's inbound byte
+// stream is inspected for a burst of RST_STREAM frames, closing the
+// connection once it exceeds cfg.MaxResetsPerSecond. If cfg is nil or
+// cfg.MaxResetsPerSecond is 0, ln is returned unwrapped.
+func WrapListener(ln net.Listener, cfg *Config) net.Listener {
+	if cfg == nil || cfg.MaxResetsPerSecond <= 0 {
+		return ln
+	}
+	return &guardedListener{Listener: ln, cfg: cfg}
+}
+
+type guardedListener struct {
+	net.Listener
+	cfg *Config
+}
+
+func (l *guardedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &resetGuardConn{Conn: conn, cfg: l.cfg, prefaceLeft: len(http2ClientPreface)}, nil
+}
+
+// resetGuardConn wraps a connection's Read path with a minimal, stateful
+// HTTP/2 frame-header scanner: just enough to count RST_STREAM frames as
+// they stream by, without buffering or re-assembling full frames.
+type resetGuardConn struct {
+	net.Conn
+	cfg *Config
+
+	mu sync.Mutex
+
+	// prefaceLeft counts down the mandatory HTTP/2 connection preface
+	// bytes still to be skipped before frame parsing can begin. It's
+	// also how scan verifies, byte-by-byte, that this connection really
+	// is cleartext HTTP/2 rather than something scan can't safely parse
+	// (most importantly, a TLS handshake).
+	prefaceLeft int
+
+	// disabled is set the moment scan sees a byte that doesn't match the
+	// expected HTTP/2 client preface -- almost always because the
+	// connection is actually TLS and scan is looking at ciphertext, not
+	// frame headers. Once set, scan stops inspecting this connection for
+	// the rest of its life instead of misreading random bytes as frames,
+	// which could otherwise misidentify noise as RST_STREAM and tear
+	// down a perfectly legitimate connection.
+	disabled bool
+
+	// hdr/hdrLen accumulate bytes of a frame header that arrived split
+	// across Read calls.
+	hdr    [http2FrameHeaderLen]byte
+	hdrLen int
+	// skip is how many payload bytes of the current frame remain to be
+	// consumed (and ignored) before the next frame header starts.
+	skip int
+
+	resets []time.Time
+}
+
+func (c *resetGuardConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.scan(b[:n])
+	}
+	return n, err
+}
+
+// scan walks buf, tracking frame boundaries just precisely enough to spot
+// RST_STREAM frame headers; it never needs to see a frame's payload.
+func (c *resetGuardConn) scan(buf []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(buf) > 0 {
+		if c.disabled {
+			return
+		}
+
+		if c.prefaceLeft > 0 {
+			consumed := len(http2ClientPreface) - c.prefaceLeft
+			n := c.prefaceLeft
+			if n > len(buf) {
+				n = len(buf)
+			}
+			for i := 0; i < n; i++ {
+				if buf[i] != http2ClientPreface[consumed+i] {
+					// Not an HTTP/2 client preface -- most likely a TLS
+					// ClientHello, which grpc-go terminates itself
+					// further down the stack where this package can't
+					// see the plaintext. Stop scanning rather than risk
+					// misreading ciphertext as a frame header.
+					c.disabled = true
+					return
+				}
+			}
+			c.prefaceLeft -= n
+			buf = buf[n:]
+			continue
+		}
+
+		if c.skip > 0 {
+			n := c.skip
+			if n > len(buf) {
+				n = len(buf)
+			}
+			c.skip -= n
+			buf = buf[n:]
+			continue
+		}
+
+		if c.hdrLen < http2FrameHeaderLen {
+			n := copy(c.hdr[c.hdrLen:], buf)
+			c.hdrLen += n
+			buf = buf[n:]
+			if c.hdrLen < http2FrameHeaderLen {
+				return
+			}
+		}
+
+		length := int(c.hdr[0])<<16 | int(c.hdr[1])<<8 | int(c.hdr[2])
+		frameType := c.hdr[3]
+		c.hdrLen = 0
+		c.skip = length
+
+		if frameType == http2FrameTypeRSTStream {
+			c.recordReset()
+		}
+	}
+}
+
+// recordReset appends a reset event and closes the connection if the
+// trailing one-second window holds more than MaxResetsPerSecond of them.
+// Must be called with c.mu held.
+func (c *resetGuardConn) recordReset() {
+	now := time.Now()
+	c.resets = append(c.resets, now)
+
+	cutoff := now.Add(-time.Second)
+	live := c.resets[:0]
+	for _, t := range c.resets {
+		if t.After(cutoff) {
+			live = append(live, t)
+		}
+	}
+	c.resets = live
+
+	if float64(len(c.resets)) > c.cfg.MaxResetsPerSecond {
+		c.Conn.Close()
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpcsafety
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeConn is a minimal net.Conn that only tracks whether Close was called.
+type fakeConn struct {
+	net.Conn
+	closed bool
+}
+
+func (f *fakeConn) Close() error {
+	f.closed = true
+	return nil
+}
+
+// http2Frame builds a raw HTTP/2 frame header (plus zero-filled payload)
+// for frameType with the given payload length.
+func http2Frame(frameType byte, payloadLen int) []byte {
+	b := make([]byte, http2FrameHeaderLen+payloadLen)
+	b[0] = byte(payloadLen >> 16)
+	b[1] = byte(payloadLen >> 8)
+	b[2] = byte(payloadLen)
+	b[3] = frameType
+	return b
+}
+
+func newTestResetGuardConn(maxPerSecond float64) (*resetGuardConn, *fakeConn) {
+	fc := &fakeConn{}
+	c := &resetGuardConn{
+		Conn:        fc,
+		cfg:         &Config{MaxResetsPerSecond: maxPerSecond},
+		prefaceLeft: len(http2ClientPreface),
+	}
+	return c, fc
+}
+
+func TestScanSkipsConnectionPreface(t *testing.T) {
+	c, fc := newTestResetGuardConn(100)
+
+	// The preface itself must never be misread as RST_STREAM frames, no
+	// matter how it's chunked across Read calls.
+	preface := []byte(http2ClientPreface)
+	c.scan(preface[:10])
+	c.scan(preface[10:])
+
+	if fc.closed {
+		t.Fatalf("connection closed while only the preface had been scanned")
+	}
+	if c.prefaceLeft != 0 {
+		t.Fatalf("prefaceLeft = %d, want 0 after consuming the full preface", c.prefaceLeft)
+	}
+}
+
+func TestScanCountsRSTStreamFrames(t *testing.T) {
+	c, fc := newTestResetGuardConn(1000) // high threshold: shouldn't trip
+
+	buf := append([]byte{}, []byte(http2ClientPreface)...)
+	buf = append(buf, http2Frame(0x4, 0)...)  // SETTINGS, should be ignored
+	buf = append(buf, http2Frame(0x3, 4)...)  // RST_STREAM #1
+	buf = append(buf, http2Frame(0x0, 10)...) // DATA, should be ignored
+	buf = append(buf, http2Frame(0x3, 4)...)  // RST_STREAM #2
+
+	// Feed it in small, misaligned chunks to exercise the cross-Read
+	// header reassembly path.
+	for i := 0; i < len(buf); i += 3 {
+		end := i + 3
+		if end > len(buf) {
+			end = len(buf)
+		}
+		c.scan(buf[i:end])
+	}
+
+	if fc.closed {
+		t.Fatalf("connection closed below the reset-rate threshold")
+	}
+	if len(c.resets) != 2 {
+		t.Fatalf("recorded %d resets, want 2", len(c.resets))
+	}
+}
+
+func TestScanClosesConnOverResetThreshold(t *testing.T) {
+	c, fc := newTestResetGuardConn(2)
+	c.prefaceLeft = 0 // preface already consumed
+
+	for i := 0; i < 5; i++ {
+		c.scan(http2Frame(0x3, 0))
+	}
+
+	if !fc.closed {
+		t.Fatalf("connection was not closed after exceeding MaxResetsPerSecond")
+	}
+}
+
+func TestScanDisablesOnNonHTTP2Preface(t *testing.T) {
+	c, fc := newTestResetGuardConn(1)
+
+	// The first bytes of a TLS ClientHello record: content type 0x16
+	// (handshake), then a version and length that don't remotely spell
+	// out the HTTP/2 client preface.
+	tlsHello := []byte{0x16, 0x03, 0x01, 0x00, 0xa5, 0x01, 0x00, 0x00, 0xa1}
+	c.scan(tlsHello)
+
+	if !c.disabled {
+		t.Fatalf("scan did not disable itself on a non-HTTP/2 preface")
+	}
+	if fc.closed {
+		t.Fatalf("connection closed while handling what should be an ignored TLS handshake")
+	}
+
+	// Once disabled, scan must not resume parsing even if what follows
+	// would otherwise look like a flood of RST_STREAM frames -- it's
+	// ciphertext, not frames, and must never be used to close the conn.
+	for i := 0; i < 5; i++ {
+		c.scan(http2Frame(0x3, 0))
+	}
+	if fc.closed {
+		t.Fatalf("connection closed from scanning bytes after scan had already disabled itself")
+	}
+}
+
+func TestRecordResetPrunesOldEntries(t *testing.T) {
+	c, fc := newTestResetGuardConn(1)
+	c.prefaceLeft = 0
+
+	c.resets = []time.Time{time.Now().Add(-2 * time.Second)}
+	c.scan(http2Frame(0x3, 0))
+
+	if fc.closed {
+		t.Fatalf("connection closed based on a reset outside the 1s window")
+	}
+	if len(c.resets) != 1 {
+		t.Fatalf("resets = %d, want the stale entry pruned and the new one recorded", len(c.resets))
+	}
+}
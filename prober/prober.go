@@ -24,7 +24,9 @@ package prober
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"net"
 	"regexp"
 	"sync"
 	"time"
@@ -33,6 +35,9 @@ import (
 	"github.com/cloudprober/cloudprober/config/runconfig"
 	"github.com/cloudprober/cloudprober/logger"
 	"github.com/cloudprober/cloudprober/metrics"
+	"github.com/cloudprober/cloudprober/prober/cluster"
+	"github.com/cloudprober/cloudprober/prober/grpcsafety"
+	"github.com/cloudprober/cloudprober/prober/probing"
 	spb "github.com/cloudprober/cloudprober/prober/proto"
 	"github.com/cloudprober/cloudprober/probes"
 	"github.com/cloudprober/cloudprober/probes/options"
@@ -61,6 +66,20 @@ type Prober struct {
 	ldLister  endpoint.Lister
 	Surfacers []*surfacers.SurfacerInfo
 
+	// cl is non-nil when HA clustering is configured. It drives which of
+	// this instance's probes are actually run, via the OnChange callback
+	// wired up in Init.
+	cl *cluster.Cluster
+
+	// peerProbing is non-nil alongside cl, providing RTT/loss/clock-skew
+	// visibility into the other members of the cluster.
+	peerProbing *probing.Manager
+
+	// peerHostByURL maps each peerProbing base URL back to the gossip
+	// peer host it was derived from, so reconcilePeerHealth can feed
+	// probing's health verdicts back into cl keyed by member name.
+	peerHostByURL map[string]string
+
 	// Context to use when starting probes
 	probeStartContext context.Context
 
@@ -105,12 +124,14 @@ func (pr *Prober) addProbe(p *probes_configpb.ProbeDef) error {
 		return status.Errorf(codes.AlreadyExists, "probe %s is already defined", p.GetName())
 	}
 
-	opts, err := options.BuildProbeOptions(p, pr.ldLister, pr.c.GetGlobalTargetsOptions(), pr.l)
+	probeLog := pr.l.With(slog.String("probe", p.GetName()), slog.String("type", p.GetType().String()))
+
+	opts, err := options.BuildProbeOptions(p, pr.ldLister, pr.c.GetGlobalTargetsOptions(), probeLog)
 	if err != nil {
 		return status.Errorf(codes.Unknown, err.Error())
 	}
 
-	pr.l.Infof("Creating a %s probe: %s", p.GetType(), p.GetName())
+	probeLog.Infof("Creating a %s probe: %s", p.GetType(), p.GetName())
 	probeInfo, err := probes.CreateProbe(p, opts)
 	if err != nil {
 		return status.Errorf(codes.Unknown, err.Error())
@@ -137,12 +158,35 @@ func (pr *Prober) Init(ctx context.Context, cfg *configpb.ProberConfig, l *logge
 	pr.c = cfg
 	pr.l = l
 
+	// Honor an explicit logging format/dedup-window override from the
+	// config; absent one, keep using the logger our caller already built.
+	if lc := cfg.GetLogging(); lc != nil {
+		pr.l = logger.New(logger.Format(lc.GetFormat()), int(lc.GetDedupWindowSec()))
+	}
+
 	// Initialize cloudprober gRPC service if configured.
 	srv := runconfig.DefaultGRPCServer()
 	if srv != nil {
 		spb.RegisterCloudproberServer(srv, pr)
 	}
 
+	// HTTP/2 abuse mitigations (rapid reset, CVE-2023-44487) and, for
+	// single-port deployments like k8s sidecars, a shared h2c listener
+	// for gRPC and the HTTP status/config endpoints. See grpcsafety for
+	// the actual stream-reset rate limiting and request multiplexing.
+	grpcSafetyCfg := &grpcsafety.Config{
+		MaxConcurrentStreams: cfg.GetGrpcHardening().GetMaxConcurrentStreams(),
+		MaxHeaderListSize:    cfg.GetGrpcHardening().GetMaxHeaderListSize(),
+		MaxResetsPerSecond:   cfg.GetGrpcHardening().GetMaxResetsPerSecond(),
+	}
+	runconfig.SetGRPCListenerWrapper(func(ln net.Listener) net.Listener {
+		return grpcsafety.WrapListener(ln, grpcSafetyCfg)
+	})
+	if cfg.GetSharedListener() != "" {
+		runconfig.SetSharedListenerHandler(cfg.GetSharedListener(),
+			grpcsafety.SharedHandler(runconfig.GRPCHandler(srv), runconfig.DefaultHTTPHandler(), grpcSafetyCfg))
+	}
+
 	// Initialize RDS server, if configured and attach to the default gRPC server.
 	// Note that we can still attach services to the default gRPC server as it's
 	// started later in Start().
@@ -200,6 +244,65 @@ func (pr *Prober) Init(ctx context.Context, cfg *configpb.ProberConfig, l *logge
 		}
 	}
 
+	// Initialize HA clustering, if configured. Once the gossip ring has
+	// converged on membership, pr.cl.Owns(name) tells us whether this
+	// instance is responsible for running a given probe; ownership
+	// changes are reconciled in reconcileClusterOwnership below.
+	if cc := pr.c.GetCluster(); cc != nil {
+		cl, err := cluster.New(&cluster.Config{
+			Name:               cc.GetName(),
+			Zone:               cc.GetZone(),
+			ZoneAware:          cc.GetZoneAware(),
+			ReplicationFactor:  int(cc.GetReplicationFactor()),
+			BindAddr:           cc.GetBindAddr(),
+			BindPort:           int(cc.GetBindPort()),
+			Peers:              cc.GetPeer(),
+			StabilizationDelay: time.Duration(cc.GetStabilizationDelaySec()) * time.Second,
+		}, pr.l)
+		if err != nil {
+			return fmt.Errorf("error initializing cluster: %v", err)
+		}
+		cl.SetProbeLister(func() []string {
+			pr.mu.Lock()
+			defer pr.mu.Unlock()
+			names := make([]string, 0, len(pr.Probes))
+			for name := range pr.Probes {
+				names = append(names, name)
+			}
+			return names
+		})
+		cl.OnChange(pr.reconcileClusterOwnership)
+		// Only join the ring once the lister and OnChange callback above
+		// are wired up -- Join can start delivering events immediately.
+		if err := cl.Join(); err != nil {
+			return fmt.Errorf("error joining cluster: %v", err)
+		}
+		pr.cl = cl
+
+		// Peer liveness probing rides on top of clustering's peer list:
+		// it gives us RTT/loss/clock-skew visibility into every peer,
+		// and lets the consistent-hash ring eject an unhealthy peer
+		// faster than gossip's own failure detector would.
+		//
+		// cluster.Config.Peers are gossip join addresses ("host:gossip-
+		// port"), not the HTTP base URLs probing.Manager needs, so they're
+		// rewritten onto the configured peer-probing HTTP port first.
+		// peerHostByURL lets reconcilePeerHealth below map each URL's
+		// health verdict back onto the gossip member (keyed by host) it
+		// came from.
+		peerURLs, peerHostByURL := peerProbeURLs(cc.GetPeer(), int(cc.GetPeerProbeHttpPort()))
+		pr.peerHostByURL = peerHostByURL
+
+		pr.peerProbing = probing.New(&probing.Config{
+			Interval:        time.Duration(cc.GetPeerProbeIntervalMsec()) * time.Millisecond,
+			Timeout:         time.Duration(cc.GetPeerProbeTimeoutMsec()) * time.Millisecond,
+			LossThreshold:   float64(cc.GetPeerLossThreshold()),
+			RTTP95Threshold: time.Duration(cc.GetPeerRttP95ThresholdMsec()) * time.Millisecond,
+		}, pr.l)
+		pr.peerProbing.SetPeers(peerURLs)
+		runconfig.SetHTTPHandler("/probing", pr.peerProbing.Handler())
+	}
+
 	// Initialize servers
 	pr.Servers, err = servers.Init(ctx, pr.c.GetServer())
 	if err != nil {
@@ -242,6 +345,12 @@ func (pr *Prober) Start(ctx context.Context) {
 	// Start a goroutine to export system variables
 	go sysvars.Start(ctx, pr.dataChan, time.Millisecond*time.Duration(pr.c.GetSysvarsIntervalMsec()), pr.c.GetSysvarsEnvVar())
 
+	// Start probing cluster peers for liveness, if clustering is configured.
+	if pr.peerProbing != nil {
+		go pr.peerProbing.Start(ctx, pr.dataChan)
+		go pr.reconcilePeerHealth(ctx)
+	}
+
 	// Start servers, each in its own goroutine
 	for _, s := range pr.Servers {
 		go s.Start(ctx, pr.dataChan)
@@ -249,6 +358,9 @@ func (pr *Prober) Start(ctx context.Context) {
 
 	if pr.c.GetDisableJitter() {
 		for name := range pr.Probes {
+			if pr.cl != nil && !pr.cl.Owns(name) {
+				continue
+			}
 			go pr.startProbe(ctx, name)
 		}
 	} else {
@@ -256,10 +368,126 @@ func (pr *Prober) Start(ctx context.Context) {
 	}
 }
 
+// reconcileClusterOwnership is invoked by the cluster subsystem, after its
+// stabilization delay, with the probes this instance has newly gained or
+// lost ownership of following a membership change. It starts/stops the
+// affected probes without touching anything else that's currently running.
+func (pr *Prober) reconcileClusterOwnership(owned, released []string) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	for _, name := range released {
+		if pr.Probes[name] != nil {
+			pr.l.Infof("Cluster: releasing ownership of probe %s", name)
+			pr._stopProbeWithNoLock(name)
+		}
+	}
+	for _, name := range owned {
+		if pr.Probes[name] != nil {
+			pr.l.Infof("Cluster: acquiring ownership of probe %s", name)
+			pr._startProbeWithNoLock(pr.probeStartContext, name)
+		}
+	}
+}
+
+// Cluster implements the debug /cluster gRPC method, returning this
+// instance's view of cluster membership and the computed probe→owner
+// table. It returns an error if clustering isn't configured.
+func (pr *Prober) Cluster(ctx context.Context, req *spb.ClusterRequest) (*spb.ClusterResponse, error) {
+	if pr.cl == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "clustering is not configured on this instance")
+	}
+
+	pr.mu.Lock()
+	names := make([]string, 0, len(pr.Probes))
+	for name := range pr.Probes {
+		names = append(names, name)
+	}
+	pr.mu.Unlock()
+
+	view := pr.cl.View(names)
+	resp := &spb.ClusterResponse{
+		LocalName: pr.cl.LocalName(),
+		Member:    view.Members,
+	}
+	for probe, owners := range view.Owners {
+		resp.Owner = append(resp.Owner, &spb.ClusterResponse_ProbeOwner{
+			Probe: probe,
+			Owner: owners,
+		})
+	}
+	return resp, nil
+}
+
+// PeerHealth returns the current liveness verdict for every cluster peer,
+// keyed by peer address. It's empty if clustering isn't configured.
+func (pr *Prober) PeerHealth() map[string]probing.Health {
+	if pr.peerProbing == nil {
+		return nil
+	}
+	return pr.peerProbing.Health()
+}
+
+// reconcilePeerHealth periodically feeds peerProbing's liveness verdicts
+// back into cl, so a peer that's failing its RTT/loss thresholds is
+// ejected from the consistent-hash ring before gossip's own failure
+// detector would mark it dead. It runs at the same cadence as the probing
+// loop itself until ctx is canceled.
+func (pr *Prober) reconcilePeerHealth(ctx context.Context) {
+	interval := pr.c.GetCluster().GetPeerProbeIntervalMsec()
+	if interval <= 0 {
+		interval = 5000
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for url, health := range pr.peerProbing.Health() {
+				host, ok := pr.peerHostByURL[url]
+				if !ok {
+					continue
+				}
+				pr.cl.SetPeerHealthy(host, health.Healthy)
+			}
+		}
+	}
+}
+
+// peerProbeURLs rewrites cluster gossip peer addresses ("host:gossip-
+// port") into HTTP base URLs ("http://host:httpPort") that probing.Manager
+// can POST to, since the gossip port never serves HTTP. It also returns a
+// lookup from each built URL back to the peer's host, so a probing health
+// verdict can be matched back to a gossip member name -- the member name
+// defaults to the peer's own hostname, which is also what appears (sans
+// port) in its gossip join address.
+func peerProbeURLs(gossipPeers []string, httpPort int) ([]string, map[string]string) {
+	if httpPort <= 0 {
+		httpPort = 9313
+	}
+	urls := make([]string, 0, len(gossipPeers))
+	hostByURL := make(map[string]string, len(gossipPeers))
+	for _, p := range gossipPeers {
+		host := p
+		if h, _, err := net.SplitHostPort(p); err == nil {
+			host = h
+		}
+		url := fmt.Sprintf("http://%s:%d", host, httpPort)
+		urls = append(urls, url)
+		hostByURL[url] = host
+	}
+	return urls, hostByURL
+}
+
 // Starts a probe without acquiring the lock
 func (pr *Prober) _startProbeWithNoLock(ctx context.Context, name string) {
 	probeCtx, cancelFunc := context.WithCancel(ctx)
 	pr.probeCancelFunc[name] = cancelFunc
+	pr.l.Event("probe_started", slog.String("probe", name),
+		slog.Int64("interval_ms", pr.Probes[name].Options.Interval.Milliseconds()))
 	go pr.Probes[name].Start(probeCtx, pr.dataChan)
 }
 func (pr *Prober) startProbe(ctx context.Context, name string) {
@@ -294,6 +522,7 @@ func (pr *Prober) _stopProbeWithNoLock(name string) {
 	} else {
 		pr.probeCancelFunc[name]()
 		delete(pr.probeCancelFunc, name)
+		pr.l.Event("probe_stopped", slog.String("probe", name))
 	}
 }
 
@@ -347,13 +576,17 @@ func (pr *Prober) startProbesWithJitter(ctx context.Context) {
 		go func(interval time.Duration, probeInfos []*probes.ProbeInfo) {
 			// Introduce a random jitter between interval buckets.
 			randomDelayMsec := rand.Int63n(int64(interval.Seconds() * 1000))
+			pr.l.Event("probe_bucket_jitter", slog.Int64("jitter_ms", randomDelayMsec),
+				slog.Int64("interval_ms", interval.Milliseconds()), slog.Int("probe_count", len(probeInfos)))
 			time.Sleep(time.Duration(randomDelayMsec) * time.Millisecond)
 
 			interProbeDelay := interval / time.Duration(len(probeInfos))
 
 			// Spread out probes evenly with an interval bucket.
 			for _, p := range probeInfos {
-				pr.l.Info("Starting probe: ", p.Name)
+				if pr.cl != nil && !pr.cl.Owns(p.Name) {
+					continue
+				}
 				go pr.startProbe(ctx, p.Name)
 				time.Sleep(interProbeDelay)
 			}
@@ -0,0 +1,322 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package probing implements lightweight peer liveness probing between
+cloudprober replicas, in the style of etcd's xiang90/probing: each
+instance periodically sends a monotonic sequence number and a send
+timestamp to every known peer's /probing HTTP endpoint, the peer echoes it
+straight back, and the sender turns the round trip into RTT, clock-skew
+and loss measurements. Results are published as EventMetrics through the
+same dataChan as every other probe, and as a simple EWMA-based per-peer
+health verdict that other subsystems (like HA clustering's consistent
+hash ring) can use to eject an unhealthy peer faster than gossip's own
+failure detector would.
+*/
+package probing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudprober/cloudprober/logger"
+	"github.com/cloudprober/cloudprober/metrics"
+)
+
+// Config tunes the probing manager.
+type Config struct {
+	// Interval between probes to each peer.
+	Interval time.Duration
+	// Timeout for a single probe round trip.
+	Timeout time.Duration
+
+	// LossThreshold is the EWMA loss rate (0-1) above which a peer is
+	// considered unhealthy.
+	LossThreshold float64
+	// RTTP95Threshold is the p95 RTT above which a peer is considered
+	// unhealthy.
+	RTTP95Threshold time.Duration
+
+	// EWMA loss moves towards the latest sample at this rate each probe.
+	// 0 defaults to 0.2.
+	LossEWMAAlpha float64
+}
+
+func (c *Config) interval() time.Duration {
+	if c.Interval <= 0 {
+		return 5 * time.Second
+	}
+	return c.Interval
+}
+
+func (c *Config) timeout() time.Duration {
+	if c.Timeout <= 0 {
+		return 2 * time.Second
+	}
+	return c.Timeout
+}
+
+func (c *Config) alpha() float64 {
+	if c.LossEWMAAlpha <= 0 {
+		return 0.2
+	}
+	return c.LossEWMAAlpha
+}
+
+// pingMsg is the wire format POSTed to, and echoed back by, a peer's
+// /probing endpoint.
+type pingMsg struct {
+	Seq        uint64 `json:"seq"`
+	SendUnixNs int64  `json:"send_unix_ns"`
+	// RecvUnixNs is filled in by the peer on echo, letting the sender
+	// estimate clock skew in addition to RTT.
+	RecvUnixNs int64 `json:"recv_unix_ns,omitempty"`
+}
+
+// Health is the liveness verdict for a single peer.
+type Health struct {
+	Healthy   bool
+	RTT       time.Duration
+	RTTP95    time.Duration
+	Loss      float64
+	ClockSkew time.Duration
+}
+
+type peerState struct {
+	addr string
+	seq  uint64
+
+	mu        sync.Mutex
+	loss      float64
+	rttSample []time.Duration // ring buffer of recent RTTs for p95
+}
+
+const rttSampleWindow = 20
+
+// Manager runs the probing loop against a set of peers and serves the
+// /probing echo endpoint for probes sent by those peers to us.
+type Manager struct {
+	cfg *Config
+	l   *logger.Logger
+
+	mu    sync.RWMutex
+	peers map[string]*peerState
+}
+
+// New creates a probing Manager. Call Start to begin probing peers, and
+// mount Handler at /probing on whatever HTTP server the instance already
+// exposes (e.g. the status server).
+func New(cfg *Config, l *logger.Logger) *Manager {
+	return &Manager{cfg: cfg, l: l, peers: make(map[string]*peerState)}
+}
+
+// SetPeers updates the set of peer base URLs (e.g. "http://10.0.0.2:9313")
+// this manager probes. Peers no longer present are dropped; new ones start
+// with a clean health history.
+func (m *Manager) SetPeers(addrs []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[string]bool, len(addrs))
+	for _, a := range addrs {
+		seen[a] = true
+		if _, ok := m.peers[a]; !ok {
+			m.peers[a] = &peerState{addr: a, loss: 0}
+		}
+	}
+	for a := range m.peers {
+		if !seen[a] {
+			delete(m.peers, a)
+		}
+	}
+}
+
+// Start runs the probing loop until ctx is canceled, one goroutine per
+// peer, emitting an EventMetrics on dataChan after every round trip:
+// peer_probe_success and peer_loss always, plus peer_rtt_us and
+// peer_clock_skew_us when the round trip succeeded.
+func (m *Manager) Start(ctx context.Context, dataChan chan *metrics.EventMetrics) {
+	ticker := time.NewTicker(m.cfg.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.mu.RLock()
+			peers := make([]*peerState, 0, len(m.peers))
+			for _, p := range m.peers {
+				peers = append(peers, p)
+			}
+			m.mu.RUnlock()
+
+			for _, p := range peers {
+				go m.probeOnce(ctx, p, dataChan)
+			}
+		}
+	}
+}
+
+func (m *Manager) probeOnce(ctx context.Context, p *peerState, dataChan chan *metrics.EventMetrics) {
+	seq := atomic.AddUint64(&p.seq, 1)
+	sendTime := time.Now()
+
+	reqBody, _ := json.Marshal(pingMsg{Seq: seq, SendUnixNs: sendTime.UnixNano()})
+
+	reqCtx, cancel := context.WithTimeout(ctx, m.cfg.timeout())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, p.addr+"/probing", bytes.NewReader(reqBody))
+	var rtt time.Duration
+	var skew time.Duration
+	success := false
+
+	if err == nil {
+		resp, herr := http.DefaultClient.Do(req)
+		if herr == nil {
+			defer resp.Body.Close()
+			var echo pingMsg
+			if json.NewDecoder(resp.Body).Decode(&echo) == nil && echo.Seq == seq {
+				rtt = time.Since(sendTime)
+				// Clock skew estimate: assume the one-way trip took
+				// RTT/2, so the peer's clock should read send+RTT/2 at
+				// the moment it received our probe.
+				expectedPeerRecv := sendTime.Add(rtt / 2)
+				skew = time.Unix(0, echo.RecvUnixNs).Sub(expectedPeerRecv)
+				success = true
+			}
+		} else if m.l != nil {
+			m.l.Warningf("probing: peer %s unreachable: %v", p.addr, herr)
+		}
+	}
+
+	m.record(p, success, rtt)
+	m.emit(p, success, rtt, skew, dataChan)
+}
+
+func (m *Manager) record(p *peerState, success bool, rtt time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sample := 1.0
+	if success {
+		sample = 0.0
+		p.rttSample = append(p.rttSample, rtt)
+		if len(p.rttSample) > rttSampleWindow {
+			p.rttSample = p.rttSample[1:]
+		}
+	}
+	p.loss = p.loss*(1-m.cfg.alpha()) + sample*m.cfg.alpha()
+}
+
+func (m *Manager) emit(p *peerState, success bool, rtt, skew time.Duration, dataChan chan *metrics.EventMetrics) {
+	em := metrics.NewEventMetrics(time.Now()).AddLabel("peer", p.addr)
+	em.AddMetric("peer_probe_success", metrics.NewInt(boolToInt(success)))
+	p.mu.Lock()
+	loss := p.loss
+	p.mu.Unlock()
+	em.AddMetric("peer_loss", metrics.NewFloat(loss))
+	if success {
+		em.AddMetric("peer_rtt_us", metrics.NewInt(rtt.Microseconds()))
+		em.AddMetric("peer_clock_skew_us", metrics.NewInt(skew.Microseconds()))
+	}
+
+	select {
+	case dataChan <- em:
+	default:
+		if m.l != nil {
+			m.l.Warningf("probing: dataChan full, dropping result for peer %s", p.addr)
+		}
+	}
+}
+
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Health returns the current liveness verdict for every known peer.
+func (m *Manager) Health() map[string]Health {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := make(map[string]Health, len(m.peers))
+	for addr, p := range m.peers {
+		p.mu.Lock()
+		loss := p.loss
+		p95 := percentile95(p.rttSample)
+		var last time.Duration
+		if len(p.rttSample) > 0 {
+			last = p.rttSample[len(p.rttSample)-1]
+		}
+		p.mu.Unlock()
+
+		out[addr] = Health{
+			Healthy: loss < m.cfg.LossThreshold && (m.cfg.RTTP95Threshold <= 0 || p95 < m.cfg.RTTP95Threshold),
+			RTT:     last,
+			RTTP95:  p95,
+			Loss:    loss,
+		}
+	}
+	return out
+}
+
+func percentile95(samples []time.Duration) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, samples...)
+	for i := 1; i < len(sorted); i++ {
+		for j := i; j > 0 && sorted[j-1] > sorted[j]; j-- {
+			sorted[j-1], sorted[j] = sorted[j], sorted[j-1]
+		}
+	}
+	idx := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// Handler serves the /probing echo endpoint: it reads a pingMsg, stamps
+// its own receive time, and writes it straight back.
+func (m *Manager) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, fmt.Sprintf("method %s not allowed", r.Method), http.StatusMethodNotAllowed)
+			return
+		}
+		var msg pingMsg
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, "invalid probing request", http.StatusBadRequest)
+			return
+		}
+		msg.RecvUnixNs = time.Now().UnixNano()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(msg)
+	})
+}
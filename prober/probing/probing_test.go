@@ -0,0 +1,92 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package probing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPercentile95Empty(t *testing.T) {
+	if got := percentile95(nil); got != 0 {
+		t.Fatalf("percentile95(nil) = %v, want 0", got)
+	}
+}
+
+func TestPercentile95(t *testing.T) {
+	samples := []time.Duration{
+		10 * time.Millisecond,
+		50 * time.Millisecond,
+		20 * time.Millisecond,
+		30 * time.Millisecond,
+		100 * time.Millisecond,
+	}
+	// Sorted: 10, 20, 30, 50, 100 (ms); ceil(0.95*5)-1 = 4 -> the max.
+	if got, want := percentile95(samples), 100*time.Millisecond; got != want {
+		t.Fatalf("percentile95(%v) = %v, want %v", samples, got, want)
+	}
+}
+
+func TestPercentile95DoesNotMutateInput(t *testing.T) {
+	samples := []time.Duration{30 * time.Millisecond, 10 * time.Millisecond, 20 * time.Millisecond}
+	orig := append([]time.Duration{}, samples...)
+
+	percentile95(samples)
+
+	for i := range samples {
+		if samples[i] != orig[i] {
+			t.Fatalf("percentile95 mutated its input: got %v, want %v", samples, orig)
+		}
+	}
+}
+
+func TestRecordTracksLossAndRTTWindow(t *testing.T) {
+	m := &Manager{cfg: &Config{LossEWMAAlpha: 1}} // alpha=1: loss jumps straight to the latest sample
+	p := &peerState{addr: "http://peer"}
+
+	m.record(p, true, 10*time.Millisecond)
+	if p.loss != 0 {
+		t.Fatalf("loss after a success = %v, want 0", p.loss)
+	}
+	if len(p.rttSample) != 1 || p.rttSample[0] != 10*time.Millisecond {
+		t.Fatalf("rttSample = %v, want [10ms]", p.rttSample)
+	}
+
+	m.record(p, false, 0)
+	if p.loss != 1 {
+		t.Fatalf("loss after a failure = %v, want 1", p.loss)
+	}
+	if len(p.rttSample) != 1 {
+		t.Fatalf("rttSample grew on a failed probe: %v", p.rttSample)
+	}
+}
+
+func TestRecordPrunesRTTSampleWindow(t *testing.T) {
+	m := &Manager{cfg: &Config{}}
+	p := &peerState{addr: "http://peer"}
+
+	for i := 0; i < rttSampleWindow+5; i++ {
+		m.record(p, true, time.Duration(i)*time.Millisecond)
+	}
+
+	if len(p.rttSample) != rttSampleWindow {
+		t.Fatalf("rttSample len = %d, want %d", len(p.rttSample), rttSampleWindow)
+	}
+	// The oldest samples should have been evicted, so the first entry left
+	// is sample index 5 (5ms).
+	if want := 5 * time.Millisecond; p.rttSample[0] != want {
+		t.Fatalf("rttSample[0] = %v, want %v", p.rttSample[0], want)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package all blank-imports every built-in probe type so that importing it
+// from a main package registers them all with the probes package. Users
+// who want a smaller binary, or who want to ship their own out-of-tree
+// probe types alongside a subset of the built-ins, should import the
+// individual probe packages they need instead of this package.
+package all
+
+import (
+	_ "github.com/cloudprober/cloudprober/probes/dns"
+	_ "github.com/cloudprober/cloudprober/probes/dnstap"
+	_ "github.com/cloudprober/cloudprober/probes/external"
+	_ "github.com/cloudprober/cloudprober/probes/grpc"
+	_ "github.com/cloudprober/cloudprober/probes/http"
+	_ "github.com/cloudprober/cloudprober/probes/ping"
+	_ "github.com/cloudprober/cloudprober/probes/tcp"
+	_ "github.com/cloudprober/cloudprober/probes/udp"
+	_ "github.com/cloudprober/cloudprober/probes/udplistener"
+)
@@ -0,0 +1,113 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dns implements a probe that actively resolves a query name
+// against its target nameserver on every probe interval, reporting
+// latency and rcode. It's the active counterpart to probes/dnstap, which
+// observes resolver traffic passively instead of generating it.
+package dns
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudprober/cloudprober/logger"
+	"github.com/cloudprober/cloudprober/metrics"
+	"github.com/cloudprober/cloudprober/probes"
+	"github.com/cloudprober/cloudprober/probes/options"
+	probes_configpb "github.com/cloudprober/cloudprober/probes/proto"
+	"github.com/miekg/dns"
+)
+
+func init() {
+	probes.Register("DNS", New, nil)
+}
+
+// Probe implements the DNS probe type.
+type Probe struct {
+	name       string
+	nameserver string
+	opts       *options.Options
+	l          *logger.Logger
+	client     *dns.Client
+
+	total   *metrics.Int
+	success *metrics.Int
+}
+
+// New returns a new DNS Probe. It's registered as the DNS probe type's
+// factory; most callers will go through probes.CreateProbe instead of
+// calling this directly.
+func New(def *probes_configpb.ProbeDef, opts *options.Options) (probes.Probe, error) {
+	return &Probe{nameserver: def.GetName()}, nil
+}
+
+// Init implements probes.Probe.
+func (p *Probe) Init(name string, opts *options.Options) error {
+	p.name = name
+	p.opts = opts
+	p.l = opts.Logger
+	p.client = &dns.Client{Timeout: opts.Timeout}
+	p.total = metrics.NewInt(0)
+	p.success = metrics.NewInt(0)
+	return nil
+}
+
+// Start implements probes.Probe. It queries p.nameserver for "." (NS)
+// once per interval until ctx is canceled, emitting latency, rcode and
+// success/total counters on dataChan.
+func (p *Probe) Start(ctx context.Context, dataChan chan *metrics.EventMetrics) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.runOnce(dataChan)
+		}
+	}
+}
+
+func (p *Probe) runOnce(dataChan chan *metrics.EventMetrics) {
+	m := new(dns.Msg)
+	m.SetQuestion(".", dns.TypeNS)
+
+	start := time.Now()
+	resp, rtt, err := p.client.Exchange(m, p.nameserver)
+
+	p.total.Inc()
+	em := metrics.NewEventMetrics(start).
+		AddLabel("probe", p.name).
+		AddLabel("dst", p.nameserver)
+
+	if err != nil {
+		p.l.Warningf("dns(%s): query to %s failed: %v", p.name, p.nameserver, err)
+	} else {
+		em.AddLabel("rcode", dns.RcodeToString[resp.Rcode])
+		if resp.Rcode == dns.RcodeSuccess {
+			p.success.Inc()
+		}
+	}
+
+	em.AddMetric("total", p.total)
+	em.AddMetric("success", p.success)
+	em.AddMetric("latency_us", metrics.NewInt(rtt.Microseconds()))
+
+	select {
+	case dataChan <- em:
+	default:
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package dnstap implements a passive DNS probe that turns dnstap frames,
+received from a resolver over a framestream connection, into cloudprober
+EventMetrics. Unlike cloudprober's other probe types it doesn't generate
+any traffic of its own: it observes the queries and responses a resolver
+is already handling.
+
+It can either listen for a resolver to connect to it (collector mode) or
+dial out to a unix socket a resolver already writes dnstap frames to
+(reader mode).
+*/
+package dnstap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+
+	"github.com/cloudprober/cloudprober/logger"
+	"github.com/cloudprober/cloudprober/metrics"
+	"github.com/cloudprober/cloudprober/probes"
+	configpb "github.com/cloudprober/cloudprober/probes/dnstap/proto"
+	"github.com/cloudprober/cloudprober/probes/options"
+	probes_configpb "github.com/cloudprober/cloudprober/probes/proto"
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+)
+
+func init() {
+	probes.Register("DNSTAP", New, (*configpb.ProbeConf)(nil))
+}
+
+// labelExtractor pulls a label out of a qname using a regex with at least
+// one capture group.
+type labelExtractor struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// Probe implements the DNSTAP probe type.
+type Probe struct {
+	name string
+	c    *configpb.ProbeConf
+	opts *options.Options
+	l    *logger.Logger
+
+	labelExtractors []labelExtractor
+
+	framesDropped *metrics.Int
+}
+
+// New returns a new dnstap Probe. It's registered as the DNSTAP probe
+// type's factory; most callers will go through probes.CreateProbe instead
+// of calling this directly.
+func New(def *probes_configpb.ProbeDef, opts *options.Options) (probes.Probe, error) {
+	c := def.GetDnstap()
+	if c == nil {
+		c = &configpb.ProbeConf{}
+	}
+	return &Probe{c: c}, nil
+}
+
+// Init implements probes.Probe.
+func (p *Probe) Init(name string, opts *options.Options) error {
+	p.name = name
+	p.opts = opts
+	p.l = opts.Logger
+	p.framesDropped = metrics.NewInt(0)
+
+	for _, le := range p.c.GetLabelExtractor() {
+		re, err := regexp.Compile(le.GetRegex())
+		if err != nil {
+			return fmt.Errorf("dnstap(%s): invalid label_extractor regex %q: %v", name, le.GetRegex(), err)
+		}
+		p.labelExtractors = append(p.labelExtractors, labelExtractor{name: le.GetLabel(), re: re})
+	}
+
+	return nil
+}
+
+// Start implements probes.Probe. It runs until ctx is canceled,
+// maintaining a framestream connection (as collector or reader, per
+// config) and turning decoded dnstap frames into EventMetrics on
+// dataChan.
+func (p *Probe) Start(ctx context.Context, dataChan chan *metrics.EventMetrics) {
+	backoff := time.Second
+	const maxBackoff = 30 * time.Second
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		conn, err := p.connect(ctx)
+		if err != nil {
+			p.l.Warningf("dnstap(%s): connect error: %v, retrying in %v", p.name, err, backoff)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+			continue
+		}
+		backoff = time.Second
+
+		p.consume(ctx, conn, dataChan)
+	}
+}
+
+// connect opens the configured framestream transport: a unix-socket or TCP
+// reader for an existing socket the resolver writes to, or a listener
+// accepting a single resolver connection when acting as a collector.
+func (p *Probe) connect(ctx context.Context) (net.Conn, error) {
+	network := "unix"
+	if p.c.GetTcpAddress() != "" {
+		network = "tcp"
+	}
+	addr := p.c.GetSocketPath()
+	if network == "tcp" {
+		addr = p.c.GetTcpAddress()
+	}
+
+	if p.c.GetCollector() {
+		ln, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		defer ln.Close()
+		return ln.Accept()
+	}
+
+	d := net.Dialer{}
+	return d.DialContext(ctx, network, addr)
+}
+
+// consume reads framestream-encoded dnstap.Message frames off conn until
+// it errors out or ctx is canceled, converting each into EventMetrics.
+func (p *Probe) consume(ctx context.Context, conn net.Conn, dataChan chan *metrics.EventMetrics) {
+	defer conn.Close()
+
+	input, err := dnstap.NewFrameStreamInputFromReader(conn, true)
+	if err != nil {
+		p.l.Warningf("dnstap(%s): framestream handshake error: %v", p.name, err)
+		return
+	}
+
+	frames := make(chan []byte)
+	go input.ReadInto(frames)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case buf, ok := <-frames:
+			if !ok {
+				return
+			}
+			dt := &dnstap.Dnstap{}
+			if err := dt.Unmarshal(buf); err != nil {
+				p.framesDropped.Inc()
+				continue
+			}
+			p.emit(dt, dataChan)
+		}
+	}
+}
+
+// emit converts a single decoded dnstap message into EventMetrics:
+// per-rcode query counts, a query/response latency distribution, and
+// per-qtype/qname counters with any configured label extraction applied.
+func (p *Probe) emit(dt *dnstap.Dnstap, dataChan chan *metrics.EventMetrics) {
+	msg := dt.GetMessage()
+	if msg == nil {
+		return
+	}
+
+	em := metrics.NewEventMetrics(time.Now()).
+		AddLabel("probe", p.name).
+		AddLabel("msg_type", msg.GetType().String())
+
+	em.AddMetric("dnstap_messages_total", metrics.NewInt(1))
+	em.AddMetric("dnstap_frames_dropped", p.framesDropped)
+
+	if msg.QueryTimeSec != nil && msg.ResponseTimeSec != nil {
+		queryUs := int64(msg.GetQueryTimeSec())*1e6 + int64(msg.GetQueryTimeNsec())/1e3
+		responseUs := int64(msg.GetResponseTimeSec())*1e6 + int64(msg.GetResponseTimeNsec())/1e3
+		em.AddMetric("dnstap_response_latency_us", metrics.NewInt(responseUs-queryUs))
+	}
+
+	// Pull the qname/qtype/rcode out of the wire-format DNS message so the
+	// regex label extractors and the per-rcode/per-qtype counters below
+	// operate on the decoded query name rather than its raw bytes. The
+	// query message carries the qname for both CLIENT_QUERY and
+	// CLIENT_RESPONSE/RESOLVER_* messages; the response message, when
+	// present, carries the authoritative rcode.
+	var qname string
+	raw := msg.GetQueryMessage()
+	if len(raw) > 0 {
+		var q dns.Msg
+		if err := q.Unpack(raw); err == nil && len(q.Question) > 0 {
+			qname = q.Question[0].Name
+			em.AddLabel("qname", qname)
+			em.AddLabel("qtype", dns.TypeToString[q.Question[0].Qtype])
+			em.AddMetric("dnstap_qtype_total", metrics.NewInt(1))
+		}
+	}
+	if raw := msg.GetResponseMessage(); len(raw) > 0 {
+		var r dns.Msg
+		if err := r.Unpack(raw); err == nil {
+			em.AddLabel("rcode", dns.RcodeToString[r.Rcode])
+			em.AddMetric("dnstap_queries_total", metrics.NewInt(1))
+		}
+	}
+
+	for _, le := range p.labelExtractors {
+		if m := le.re.FindStringSubmatch(qname); len(m) > 1 {
+			em.AddLabel(le.name, m[1])
+		}
+	}
+
+	select {
+	case dataChan <- em:
+	default:
+		p.framesDropped.Inc()
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package http implements a probe that issues a GET request to its target
+// on every probe interval and reports latency and response-code buckets.
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cloudprober/cloudprober/logger"
+	"github.com/cloudprober/cloudprober/metrics"
+	"github.com/cloudprober/cloudprober/probes"
+	"github.com/cloudprober/cloudprober/probes/options"
+	probes_configpb "github.com/cloudprober/cloudprober/probes/proto"
+)
+
+func init() {
+	probes.Register("HTTP", New, nil)
+}
+
+// Probe implements the HTTP probe type.
+type Probe struct {
+	name   string
+	target string
+	opts   *options.Options
+	l      *logger.Logger
+	client *http.Client
+
+	total   *metrics.Int
+	success *metrics.Int
+}
+
+// New returns a new HTTP Probe. It's registered as the HTTP probe type's
+// factory; most callers will go through probes.CreateProbe instead of
+// calling this directly.
+func New(def *probes_configpb.ProbeDef, opts *options.Options) (probes.Probe, error) {
+	return &Probe{target: def.GetName()}, nil
+}
+
+// Init implements probes.Probe.
+func (p *Probe) Init(name string, opts *options.Options) error {
+	p.name = name
+	p.opts = opts
+	p.l = opts.Logger
+	p.client = &http.Client{Timeout: opts.Timeout}
+	p.total = metrics.NewInt(0)
+	p.success = metrics.NewInt(0)
+	return nil
+}
+
+// Start implements probes.Probe. It GETs p.target once per interval until
+// ctx is canceled, emitting latency, status-code and success/total counters
+// on dataChan.
+func (p *Probe) Start(ctx context.Context, dataChan chan *metrics.EventMetrics) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.runOnce(ctx, dataChan)
+		}
+	}
+}
+
+func (p *Probe) runOnce(ctx context.Context, dataChan chan *metrics.EventMetrics) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.target, nil)
+	if err != nil {
+		p.l.Warningf("http(%s): building request for %s failed: %v", p.name, p.target, err)
+		return
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	latency := time.Since(start)
+
+	p.total.Inc()
+	em := metrics.NewEventMetrics(start).
+		AddLabel("probe", p.name).
+		AddLabel("dst", p.target)
+
+	if err != nil {
+		p.l.Warningf("http(%s): request to %s failed: %v", p.name, p.target, err)
+	} else {
+		resp.Body.Close()
+		em.AddLabel("status_code", resp.Status)
+		if resp.StatusCode < 400 {
+			p.success.Inc()
+		}
+	}
+
+	em.AddMetric("total", p.total)
+	em.AddMetric("success", p.success)
+	em.AddMetric("latency_us", metrics.NewInt(latency.Microseconds()))
+
+	select {
+	case dataChan <- em:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ping implements an ICMP echo ("ping") probe, sending one echo
+// request to its target per probe interval and reporting round-trip
+// latency and loss.
+package ping
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/cloudprober/cloudprober/logger"
+	"github.com/cloudprober/cloudprober/metrics"
+	"github.com/cloudprober/cloudprober/probes"
+	"github.com/cloudprober/cloudprober/probes/options"
+	probes_configpb "github.com/cloudprober/cloudprober/probes/proto"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+func init() {
+	probes.Register("PING", New, nil)
+}
+
+// Probe implements the PING probe type.
+type Probe struct {
+	name   string
+	target string
+	opts   *options.Options
+	l      *logger.Logger
+
+	total   *metrics.Int
+	success *metrics.Int
+}
+
+// New returns a new PING Probe. It's registered as the PING probe type's
+// factory; most callers will go through probes.CreateProbe instead of
+// calling this directly.
+func New(def *probes_configpb.ProbeDef, opts *options.Options) (probes.Probe, error) {
+	return &Probe{target: def.GetName()}, nil
+}
+
+// Init implements probes.Probe.
+func (p *Probe) Init(name string, opts *options.Options) error {
+	p.name = name
+	p.opts = opts
+	p.l = opts.Logger
+	p.total = metrics.NewInt(0)
+	p.success = metrics.NewInt(0)
+	return nil
+}
+
+// Start implements probes.Probe. It sends a single ICMP echo request to
+// p.target once per interval until ctx is canceled, emitting round-trip
+// latency and success/total counters on dataChan. It uses an unprivileged
+// ICMP datagram socket ("udp4") only, so it works only where the OS lets
+// the running user open one; it never opens a raw ICMP socket.
+func (p *Probe) Start(ctx context.Context, dataChan chan *metrics.EventMetrics) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.runOnce(dataChan)
+		}
+	}
+}
+
+func (p *Probe) runOnce(dataChan chan *metrics.EventMetrics) {
+	start := time.Now()
+	rtt, err := p.ping()
+
+	p.total.Inc()
+	em := metrics.NewEventMetrics(start).
+		AddLabel("probe", p.name).
+		AddLabel("dst", p.target)
+
+	if err != nil {
+		p.l.Warningf("ping(%s): echo to %s failed: %v", p.name, p.target, err)
+	} else {
+		p.success.Inc()
+		em.AddMetric("latency_us", metrics.NewInt(rtt.Microseconds()))
+	}
+
+	em.AddMetric("total", p.total)
+	em.AddMetric("success", p.success)
+
+	select {
+	case dataChan <- em:
+	default:
+	}
+}
+
+func (p *Probe) ping() (time.Duration, error) {
+	conn, err := icmp.ListenPacket("udp4", "0.0.0.0")
+	if err != nil {
+		return 0, fmt.Errorf("listening for ICMP replies: %v", err)
+	}
+	defer conn.Close()
+
+	msg := icmp.Message{
+		Type: ipv4.ICMPTypeEcho,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   os.Getpid() & 0xffff,
+			Seq:  1,
+			Data: []byte("cloudprober-ping-probe"),
+		},
+	}
+	wb, err := msg.Marshal(nil)
+	if err != nil {
+		return 0, fmt.Errorf("marshaling echo request: %v", err)
+	}
+
+	dst, err := net.ResolveIPAddr("ip4", p.target)
+	if err != nil {
+		return 0, fmt.Errorf("resolving %s: %v", p.target, err)
+	}
+
+	start := time.Now()
+	if _, err := conn.WriteTo(wb, &net.UDPAddr{IP: dst.IP}); err != nil {
+		return 0, fmt.Errorf("sending echo request: %v", err)
+	}
+
+	conn.SetReadDeadline(start.Add(p.opts.Timeout))
+	rb := make([]byte, 1500)
+	n, _, err := conn.ReadFrom(rb)
+	if err != nil {
+		return 0, fmt.Errorf("reading echo reply: %v", err)
+	}
+	rtt := time.Since(start)
+
+	rm, err := icmp.ParseMessage(1 /* protoICMP */, rb[:n])
+	if err != nil {
+		return 0, fmt.Errorf("parsing echo reply: %v", err)
+	}
+	if rm.Type != ipv4.ICMPTypeEchoReply {
+		return 0, fmt.Errorf("unexpected ICMP reply type %v", rm.Type)
+	}
+	return rtt, nil
+}
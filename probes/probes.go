@@ -0,0 +1,165 @@
+// Copyright 2017-2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package probes provides an interface for cloudprober probes and a registry
+that probe implementations contribute themselves to from init().
+
+Built-in probe types register themselves via side-effect import of the
+probes/all umbrella package (or any subset of its constituent packages);
+this keeps CreateProbe itself free of a hard-coded list of types, so
+out-of-tree probe types can be added by a user's own main package without
+forking this repo.
+*/
+package probes
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cloudprober/cloudprober/metrics"
+	"github.com/cloudprober/cloudprober/probes/options"
+	probes_configpb "github.com/cloudprober/cloudprober/probes/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Probe is the interface that every probe type implements.
+type Probe interface {
+	// Init initializes the probe with the given name and options.
+	Init(name string, opts *options.Options) error
+
+	// Start starts the probe background goroutine(s). It blocks until
+	// ctx is canceled, emitting EventMetrics on dataChan as results come
+	// in.
+	Start(ctx context.Context, dataChan chan *metrics.EventMetrics)
+}
+
+// ProbeInfo wraps a Probe along with the metadata the prober package needs
+// to schedule and report on it.
+type ProbeInfo struct {
+	Probe
+	Name    string
+	Options *options.Options
+}
+
+// Factory builds a Probe from its proto definition and options. The factory
+// reads its own type-specific config from def; CreateProbe does not decode
+// that config for it.
+type Factory func(def *probes_configpb.ProbeDef, opts *options.Options) (Probe, error)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]Factory)
+	extensions = make(map[string]proto.Message)
+)
+
+// Register adds a probe type to the registry, to be picked up by
+// CreateProbe. It's meant to be called from a probe package's init(),
+// e.g.:
+//
+//	func init() {
+//		probes.Register("HTTP", New, (*httppb.ProbeConf)(nil))
+//	}
+//
+// extension is the message type of the type-specific config the factory
+// expects def to carry; CreateProbe only checks that def has that config
+// set (see hasMatchingExtension) and does not decode it. extension may be
+// nil for probe types that don't carry type-specific config. Register panics on a duplicate type name, consistent with other
+// registries in this codebase (e.g. surfacer registration) -- it
+// represents a build-time wiring mistake, not a runtime condition.
+func Register(typeName string, factory Factory, extension proto.Message) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[typeName]; ok {
+		panic(fmt.Sprintf("probes: type %s is already registered", typeName))
+	}
+	registry[typeName] = factory
+	if extension != nil {
+		extensions[typeName] = extension
+	}
+}
+
+// CreateProbe builds a Probe for def using whatever factory was registered
+// for def.GetType(). Callers must blank-import probes/all (or the specific
+// probe packages they need) so that registration has happened before
+// CreateProbe is called.
+func CreateProbe(def *probes_configpb.ProbeDef, opts *options.Options) (*ProbeInfo, error) {
+	typeName := def.GetType().String()
+
+	registryMu.Lock()
+	factory, ok := registry[typeName]
+	ext := extensions[typeName]
+	registryMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("probes: no probe type registered for %q; is it blank-imported (e.g. via probes/all)?", typeName)
+	}
+
+	if ext != nil && !hasMatchingExtension(def, ext) {
+		return nil, fmt.Errorf("probes: %s probe %s has no %s config set; check for a copy-pasted probe type", typeName, def.GetName(), proto.MessageName(ext))
+	}
+
+	p, err := factory(def, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s probe %s: %v", typeName, def.GetName(), err)
+	}
+	if err := p.Init(def.GetName(), opts); err != nil {
+		return nil, fmt.Errorf("error initializing %s probe %s: %v", typeName, def.GetName(), err)
+	}
+
+	return &ProbeInfo{
+		Probe:   p,
+		Name:    def.GetName(),
+		Options: opts,
+	}, nil
+}
+
+// hasMatchingExtension reports whether def carries a populated extension
+// field whose message type matches want, i.e. that def.GetType() and its
+// type-specific config actually agree with each other. This is what makes
+// the extension registered in Register useful: it lets CreateProbe catch a
+// probe def with, say, DNSTAP as its type but an http config populated
+// (e.g. from a copy-pasted probe block) without a second type-name switch.
+//
+// want's extension is almost always declared as a top-level "extend
+// ProbeDef { ... }" block in the probe package's own .proto file rather
+// than nested inside ProbeDef's own message body, so def.ProtoReflect().
+// Descriptor().Extensions() -- which only sees the latter -- won't find
+// it. protoregistry.GlobalTypes indexes every extension registered
+// against ProbeDef regardless of which file declared it, which is what
+// RangeExtensionsByMessage searches here. A config held in one of
+// ProbeDef's own fields (as DNSTAP's is, read via def.GetDnstap()) is
+// checked first.
+func hasMatchingExtension(def *probes_configpb.ProbeDef, want proto.Message) bool {
+	wantName := protoreflect.FullName(proto.MessageName(want))
+	fields := def.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if fd := fields.Get(i); fd.Message() != nil && fd.Message().FullName() == wantName {
+			return def.ProtoReflect().Has(fd)
+		}
+	}
+	found := false
+	protoregistry.GlobalTypes.RangeExtensionsByMessage(def.ProtoReflect().Descriptor().FullName(), func(xt protoreflect.ExtensionType) bool {
+		fd := xt.TypeDescriptor()
+		if fd.Message() == nil || fd.Message().FullName() != wantName {
+			return true
+		}
+		found = def.ProtoReflect().Has(xt.TypeDescriptor())
+		return !found
+	})
+	return found
+}
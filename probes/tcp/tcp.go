@@ -0,0 +1,105 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tcp implements a probe that establishes a TCP connection to its
+// target on every probe interval and reports connect latency and success.
+package tcp
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/cloudprober/cloudprober/logger"
+	"github.com/cloudprober/cloudprober/metrics"
+	"github.com/cloudprober/cloudprober/probes"
+	"github.com/cloudprober/cloudprober/probes/options"
+	probes_configpb "github.com/cloudprober/cloudprober/probes/proto"
+)
+
+func init() {
+	probes.Register("TCP", New, nil)
+}
+
+// Probe implements the TCP probe type.
+type Probe struct {
+	name   string
+	target string
+	opts   *options.Options
+	l      *logger.Logger
+
+	total   *metrics.Int
+	success *metrics.Int
+}
+
+// New returns a new TCP Probe. It's registered as the TCP probe type's
+// factory; most callers will go through probes.CreateProbe instead of
+// calling this directly.
+func New(def *probes_configpb.ProbeDef, opts *options.Options) (probes.Probe, error) {
+	return &Probe{target: def.GetName()}, nil
+}
+
+// Init implements probes.Probe.
+func (p *Probe) Init(name string, opts *options.Options) error {
+	p.name = name
+	p.opts = opts
+	p.l = opts.Logger
+	p.total = metrics.NewInt(0)
+	p.success = metrics.NewInt(0)
+	return nil
+}
+
+// Start implements probes.Probe. It dials p.target once per interval until
+// ctx is canceled, emitting connect latency and success/total counters on
+// dataChan.
+func (p *Probe) Start(ctx context.Context, dataChan chan *metrics.EventMetrics) {
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.runOnce(ctx, dataChan)
+		}
+	}
+}
+
+func (p *Probe) runOnce(ctx context.Context, dataChan chan *metrics.EventMetrics) {
+	start := time.Now()
+	d := net.Dialer{Timeout: p.opts.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", p.target)
+	latency := time.Since(start)
+
+	p.total.Inc()
+	if err != nil {
+		p.l.Warningf("tcp(%s): connect to %s failed: %v", p.name, p.target, err)
+	} else {
+		conn.Close()
+		p.success.Inc()
+	}
+
+	em := metrics.NewEventMetrics(start).
+		AddLabel("probe", p.name).
+		AddLabel("dst", p.target)
+	em.AddMetric("total", p.total)
+	em.AddMetric("success", p.success)
+	em.AddMetric("latency_us", metrics.NewInt(latency.Microseconds()))
+
+	select {
+	case dataChan <- em:
+	case <-ctx.Done():
+	}
+}
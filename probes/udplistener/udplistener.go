@@ -0,0 +1,114 @@
+// Copyright 2024 The Cloudprober Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package udplistener implements a passive probe that listens on a UDP
+// socket and counts the datagrams it receives, for exercising an
+// already-running service's client traffic rather than generating probe
+// traffic of its own (the UDP analogue of probes/dnstap's collector mode).
+package udplistener
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/cloudprober/cloudprober/logger"
+	"github.com/cloudprober/cloudprober/metrics"
+	"github.com/cloudprober/cloudprober/probes"
+	"github.com/cloudprober/cloudprober/probes/options"
+	probes_configpb "github.com/cloudprober/cloudprober/probes/proto"
+)
+
+func init() {
+	probes.Register("UDP_LISTENER", New, nil)
+}
+
+// Probe implements the UDP_LISTENER probe type. The probe def's name is
+// used verbatim as the "host:port" address to listen on.
+type Probe struct {
+	name string
+	addr string
+	opts *options.Options
+	l    *logger.Logger
+
+	packetsReceived *metrics.Int
+}
+
+// New returns a new UDP_LISTENER Probe. It's registered as the
+// UDP_LISTENER probe type's factory; most callers will go through
+// probes.CreateProbe instead of calling this directly.
+func New(def *probes_configpb.ProbeDef, opts *options.Options) (probes.Probe, error) {
+	return &Probe{addr: def.GetName()}, nil
+}
+
+// Init implements probes.Probe.
+func (p *Probe) Init(name string, opts *options.Options) error {
+	p.name = name
+	p.opts = opts
+	p.l = opts.Logger
+	p.packetsReceived = metrics.NewInt(0)
+	return nil
+}
+
+// Start implements probes.Probe. It listens on p.addr until ctx is
+// canceled, emitting a running packets-received counter on dataChan once
+// per interval.
+func (p *Probe) Start(ctx context.Context, dataChan chan *metrics.EventMetrics) {
+	conn, err := net.ListenPacket("udp", p.addr)
+	if err != nil {
+		p.l.Warningf("udplistener(%s): listen on %s failed: %v", p.name, p.addr, err)
+		return
+	}
+	defer conn.Close()
+
+	go p.recvLoop(ctx, conn)
+
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			em := metrics.NewEventMetrics(time.Now()).
+				AddLabel("probe", p.name).
+				AddLabel("listen_addr", p.addr)
+			em.AddMetric("packets_received", p.packetsReceived)
+
+			select {
+			case dataChan <- em:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func (p *Probe) recvLoop(ctx context.Context, conn net.PacketConn) {
+	buf := make([]byte, 65536)
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if _, _, err := conn.ReadFrom(buf); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+		p.packetsReceived.Inc()
+	}
+}